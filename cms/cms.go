@@ -0,0 +1,271 @@
+// Package cms implements a Count-Min Sketch, an approximate frequency
+// table: Add records occurrences of a key and Estimate returns an
+// upper-bound estimate of how many times it's been seen, using O(w*d)
+// space regardless of the number of distinct keys.
+//
+// References:
+// - http://dimacs.rutgers.edu/~graham/pubs/papers/cm-full.pdf
+package cms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"io"
+	"math"
+
+	"github.com/vdinovi/hyperloglog/internal/binutil"
+	"github.com/vdinovi/hyperloglog/internal/hashid"
+)
+
+const minWidth, minDepth = 1, 1
+
+// maxWidth and maxDepth bound width/depth on decode. They're far beyond any
+// realistic sketch size (a 1<<20 x 1<<10 sketch is already gigabytes of
+// counts) and exist only so corrupted or malicious dimensions can't drive
+// an unbounded allocation.
+const maxWidth, maxDepth = 1 << 24, 1 << 16
+
+var (
+	errDimensionTooSmall = fmt.Errorf("width and depth must each be at least %d", minDepth)
+	errDimensionMismatch = fmt.Errorf("cannot merge sketches with different dimensions")
+	errHashMismatch      = fmt.Errorf("cannot merge sketches that use different hash functions")
+)
+
+// magic identifies the on-disk/wire format produced by MarshalBinary.
+var magic = [4]byte{'C', 'M', 'S', '1'}
+
+// formatVersion1 is the only format version this package currently writes.
+const formatVersion1 = 1
+
+var (
+	errBadMagic          = fmt.Errorf("cms: data does not start with the expected magic bytes")
+	errUnsupportedFormat = fmt.Errorf("cms: unsupported format version")
+	errUnregisteredHash  = fmt.Errorf("cms: hash is not registered; call RegisterHash before unmarshaling a Sketch that used it")
+)
+
+// hashRegistry maps a hash identifier (see internal/hashid) to the factory
+// that produces it, so UnmarshalBinary can reconstruct a working Sketch
+// rather than just its counts. The default FNV-1a hash is always available;
+// custom hashes passed to NewSketchWithHash must be registered with
+// RegisterHash before unmarshaling a Sketch that used them.
+var hashRegistry = map[string]func() hash.Hash64{}
+
+func init() {
+	registerHash(func() hash.Hash64 { return fnv.New64a() })
+}
+
+// RegisterHash makes h available to UnmarshalBinary so a Sketch serialized
+// while using h can be fully restored, including the ability to keep
+// calling Add/Estimate.
+func RegisterHash(h func() hash.Hash64) {
+	registerHash(h)
+}
+
+func registerHash(h func() hash.Hash64) {
+	hashRegistry[hashid.TypeID(h)] = h
+}
+
+// A Sketch holds approximate per-key counts in a width x depth grid of
+// counters. Add increments one counter per row via d independent hashes of
+// the key; Estimate returns the smallest of those counters, which is never
+// less than the true count and only overestimates due to hash collisions.
+type Sketch struct {
+	width, depth uint32
+	counts       [][]uint64
+	seeds        []uint64
+	newHash      func() hash.Hash64
+	hashID       string
+}
+
+// NewSketch returns a new Sketch of the given width and depth, hashing keys
+// with FNV-1a. See NewSketchWithHash to supply a different hash.Hash64.
+func NewSketch(width, depth uint32) (*Sketch, error) {
+	return NewSketchWithHash(width, depth, func() hash.Hash64 { return fnv.New64a() })
+}
+
+// NewSketchWithHash returns a new Sketch that hashes keys using the
+// hash.Hash64 instances produced by h. At construction h is called once to
+// fingerprint the hash and once for an instance that derives every row's
+// seed; it is called once more per Add/Estimate call to actually hash a key.
+func NewSketchWithHash(width, depth uint32, h func() hash.Hash64) (*Sketch, error) {
+	if width < minWidth || depth < minDepth {
+		return nil, errDimensionTooSmall
+	}
+	s := &Sketch{
+		width:   width,
+		depth:   depth,
+		counts:  make([][]uint64, depth),
+		seeds:   make([]uint64, depth),
+		newHash: h,
+		hashID:  hashid.TypeID(h),
+	}
+	seedHash := h()
+	for row := range s.counts {
+		s.counts[row] = make([]uint64, width)
+		// Derive independent per-row seeds from the same hash factory by
+		// hashing the row index, rather than requiring d separate factories.
+		seedHash.Reset()
+		var buf [4]byte
+		binary.BigEndian.PutUint32(buf[:], uint32(row))
+		seedHash.Write(buf[:])
+		s.seeds[row] = seedHash.Sum64()
+	}
+	return s, nil
+}
+
+// Add records delta occurrences of key.
+func (s *Sketch) Add(key []byte, delta uint64) {
+	h := s.newHash()
+	for row := uint32(0); row < s.depth; row++ {
+		col := s.index(h, row, key)
+		s.counts[row][col] += delta
+	}
+}
+
+// Estimate returns an upper-bound estimate of how many times key has been
+// added, via Add.
+func (s *Sketch) Estimate(key []byte) uint64 {
+	h := s.newHash()
+	min := uint64(math.MaxUint64)
+	for row := uint32(0); row < s.depth; row++ {
+		col := s.index(h, row, key)
+		if c := s.counts[row][col]; c < min {
+			min = c
+		}
+	}
+	return min
+}
+
+// index hashes key against the given row's seed and returns the resulting
+// column, reusing h across rows rather than constructing a new hash per row.
+func (s *Sketch) index(h hash.Hash64, row uint32, key []byte) uint32 {
+	h.Reset()
+	var seedBuf [8]byte
+	binary.BigEndian.PutUint64(seedBuf[:], s.seeds[row])
+	h.Write(seedBuf[:])
+	h.Write(key)
+	return uint32(h.Sum64() % uint64(s.width))
+}
+
+// Merge folds other's counts into a new Sketch, summing matching counters.
+// Both sketches must share the same dimensions and hash function.
+func (s *Sketch) Merge(other *Sketch) (*Sketch, error) {
+	if s.width != other.width || s.depth != other.depth {
+		return nil, errDimensionMismatch
+	}
+	if s.hashID != other.hashID {
+		return nil, errHashMismatch
+	}
+	merged, err := NewSketchWithHash(s.width, s.depth, s.newHash)
+	if err != nil {
+		return nil, err
+	}
+	for row := uint32(0); row < s.depth; row++ {
+		for col := uint32(0); col < s.width; col++ {
+			merged.counts[row][col] = s.counts[row][col] + other.counts[row][col]
+		}
+	}
+	return merged, nil
+}
+
+// MarshalBinary encodes the sketch into a small versioned, framed format: a
+// 4-byte magic, a 1-byte version, varint width and depth, a length-prefixed
+// hash identifier, the per-row seeds, and finally the counts matrix -
+// mirroring the framing hyperloglog.Counter uses.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	buf.WriteByte(formatVersion1)
+
+	binutil.WriteUvarint(&buf, uint64(s.width))
+	binutil.WriteUvarint(&buf, uint64(s.depth))
+	binutil.WriteString(&buf, s.hashID)
+
+	for _, seed := range s.seeds {
+		binutil.WriteUvarint(&buf, seed)
+	}
+	for _, row := range s.counts {
+		for _, count := range row {
+			binutil.WriteUvarint(&buf, count)
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a Sketch previously encoded with MarshalBinary,
+// replacing the receiver's contents.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var gotMagic [4]byte
+	if _, err := io.ReadFull(r, gotMagic[:]); err != nil || gotMagic != magic {
+		return errBadMagic
+	}
+	version, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != formatVersion1 {
+		return fmt.Errorf("%w: %d", errUnsupportedFormat, version)
+	}
+	width, err := binutil.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if err := binutil.CheckDimension("width", width, minWidth, maxWidth); err != nil {
+		return err
+	}
+	depth, err := binutil.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if err := binutil.CheckDimension("depth", depth, minDepth, maxDepth); err != nil {
+		return err
+	}
+	hashID, err := binutil.ReadString(r)
+	if err != nil {
+		return err
+	}
+	newHash, ok := hashRegistry[hashID]
+	if !ok {
+		return fmt.Errorf("%w: %q", errUnregisteredHash, hashID)
+	}
+
+	// depth seeds plus width*depth counts, checked together since both are
+	// still ahead of r's current position.
+	if err := binutil.CheckLen(r, depth+width*depth); err != nil {
+		return err
+	}
+
+	unmarshaled := Sketch{
+		width:   uint32(width),
+		depth:   uint32(depth),
+		newHash: newHash,
+		hashID:  hashID,
+		seeds:   make([]uint64, depth),
+		counts:  make([][]uint64, depth),
+	}
+	for i := range unmarshaled.seeds {
+		seed, err := binutil.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		unmarshaled.seeds[i] = seed
+	}
+	for row := range unmarshaled.counts {
+		unmarshaled.counts[row] = make([]uint64, width)
+		for col := range unmarshaled.counts[row] {
+			count, err := binutil.ReadUvarint(r)
+			if err != nil {
+				return err
+			}
+			unmarshaled.counts[row][col] = count
+		}
+	}
+
+	*s = unmarshaled
+	return nil
+}
@@ -0,0 +1,157 @@
+package cms_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/vdinovi/hyperloglog/cms"
+)
+
+// TestSketchEstimate checks that Estimate never undercounts a key's true
+// frequency and stays within four times the sketch's collision-driven error
+// bound of roughly e*totalCount/width (the bound itself holds per key only
+// with probability 1-e^-depth).
+func TestSketchEstimate(t *testing.T) {
+	const width, depth = 2048, 4
+	const distinctKeys = 10_000
+
+	s, err := cms.NewSketch(width, depth)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	want := make(map[string]uint64, distinctKeys)
+	var total uint64
+	for i := 0; i < distinctKeys; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		count := uint64(i%7 + 1)
+		for j := uint64(0); j < count; j++ {
+			s.Add([]byte(key), 1)
+		}
+		want[key] = count
+		total += count
+	}
+
+	tolerance := uint64(math.Ceil(4 * math.E * float64(total) / width))
+	for key, count := range want {
+		got := s.Estimate([]byte(key))
+		if got < count {
+			t.Fatalf("estimate for %q: got %d, want at least %d", key, got, count)
+		}
+		if got > count+tolerance {
+			t.Errorf("estimate for %q: got %d, want ~%d (+/- %d)", key, got, count, tolerance)
+		}
+	}
+}
+
+// TestSketchMerge checks that merging two sketches sums their per-key
+// counts, matching the result of adding both streams to one sketch.
+func TestSketchMerge(t *testing.T) {
+	a, err := cms.NewSketch(1024, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := cms.NewSketch(1024, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	a.Add([]byte("shared"), 3)
+	b.Add([]byte("shared"), 4)
+	a.Add([]byte("a-only"), 5)
+	b.Add([]byte("b-only"), 6)
+
+	merged, err := a.Merge(b)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := merged.Estimate([]byte("shared")); got != 7 {
+		t.Errorf("shared: got %d, want 7", got)
+	}
+	if got := merged.Estimate([]byte("a-only")); got != 5 {
+		t.Errorf("a-only: got %d, want 5", got)
+	}
+	if got := merged.Estimate([]byte("b-only")); got != 6 {
+		t.Errorf("b-only: got %d, want 6", got)
+	}
+}
+
+// TestSketchMergeRejectsMismatch checks that Merge refuses sketches with
+// different dimensions or hash functions rather than silently producing a
+// nonsense result.
+func TestSketchMergeRejectsMismatch(t *testing.T) {
+	a, err := cms.NewSketch(1024, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := cms.NewSketch(2048, 4)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := a.Merge(b); err == nil {
+		t.Errorf("expected Merge to reject sketches with different dimensions")
+	}
+}
+
+// TestSketchMarshalRoundTrip checks that a sketch's counts survive a
+// MarshalBinary/UnmarshalBinary round trip and that Add still works
+// afterward.
+func TestSketchMarshalRoundTrip(t *testing.T) {
+	s, err := cms.NewSketch(256, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.Add([]byte("a"), 2)
+	s.Add([]byte("b"), 5)
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	restored, err := cms.NewSketch(256, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if got := restored.Estimate([]byte("a")); got != 2 {
+		t.Errorf("a: got %d, want 2", got)
+	}
+	if got := restored.Estimate([]byte("b")); got != 5 {
+		t.Errorf("b: got %d, want 5", got)
+	}
+
+	restored.Add([]byte("a"), 1)
+	if got := restored.Estimate([]byte("a")); got != 3 {
+		t.Errorf("a after Add: got %d, want 3", got)
+	}
+}
+
+// TestSketchUnmarshalRejectsBadDimensions checks that decoding a payload
+// whose width has been corrupted into an absurdly large value returns an
+// error instead of driving an unbounded allocation.
+func TestSketchUnmarshalRejectsBadDimensions(t *testing.T) {
+	s, err := cms.NewSketch(64, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// width's varint starts right after the 4-byte magic and 1-byte version.
+	huge := append([]byte(nil), data[:5]...)
+	huge = append(huge, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)
+	huge = append(huge, data[6:]...)
+
+	var restored cms.Sketch
+	if err := restored.UnmarshalBinary(huge); err == nil {
+		t.Errorf("expected an error decoding an absurdly large width, got nil")
+	}
+}
@@ -1,105 +1,241 @@
-// Package hyperloglog implements the hyperloglog algorithm for approximating
-// the cardinality of distinct items in a multiset.
+// Package hyperloglog approximates the cardinality of distinct items in a
+// multiset, following the structure of the HyperLogLog++ algorithm: a
+// sparse representation for small cardinalities, a 64-bit hash, and a
+// bias-corrected raw estimate below a precision-dependent threshold.
+//
+// The bias-correction curves in biasTables are NOT the tables published
+// alongside the HyperLogLog++ paper (see estimate.go); they're hand-fit
+// approximations of the same shape. Callers that need the paper's accuracy
+// guarantee in the transition region should substitute the real tables
+// before relying on Count() there; everywhere else (the small-range linear
+// counting path and the large-range raw estimate) matches the paper.
 //
 // References:
 // - https://en.wikipedia.org/wiki/HyperLogLog
 // - https://algo.inria.fr/flajolet/Publications/FlFuGaMe07.pdf
+// - https://research.google/pubs/pub40671/ (HyperLogLog++)
 // - http://antirez.com/news/75
 package hyperloglog
 
 import (
-	"crypto/sha256"
-	"encoding/binary"
 	"fmt"
+	"hash"
 	"math"
+	"math/bits"
 )
 
 // A counter holds the approximate state of the multiset.
 // Values are presented via the Add method and an approximation
-// of the count is given by the Count method
+// of the count is given by the Count method.
+//
+// A counter starts out in sparse mode, where observations are held as a
+// sorted list of (register index, rho) pairs. This is far cheaper than a
+// full register array while the number of distinct observations is small.
+// The counter converts itself to the dense representation (m registers of
+// regBits each, bit-packed into regs) once the sparse representation grows
+// past roughly 6*m bytes or holds more than 3m/5 entries, whichever comes
+// first; see addHash.
 type Counter struct {
-	regs  []uint8
-	m     uint64
-	b     uint64
-	alpha float64
-	hash  func([]byte, []byte) int
-	hbuf  []byte
+	regs   []byte     // dense registers, bit-packed at regBits each; nil in sparse mode
+	sparse *sparseSet // sparse registers; nil once converted to dense
+
+	m       uint64
+	b       uint64
+	alpha   float64
+	newHash func() hash.Hash64
+	hashID  string
+	h       hash.Hash64
 }
 
 const minNumRegisters = 16
 
+// sparseByteBudget is the multiple of m (in bytes) a sparse representation
+// is allowed to reach before the counter converts to dense.
+const sparseByteBudget = 6
+
 var (
 	errNumRegistersTooSmall = fmt.Errorf("numRegisters must be greater than %d", minNumRegisters)
 )
 
-// Returns a new HyperLogLog counter
+// Returns a new HyperLogLog counter that hashes observations with SHA-256.
+// SHA-256 is a cryptographic hash and is slower than it needs to be for
+// this purpose; use NewCounterWithHash to supply a faster hash.Hash64, such
+// as murmur3 or xxhash, for throughput-sensitive workloads.
 func NewCounter(numRegisters uint32) (*Counter, error) {
+	return NewCounterWithHash(numRegisters, newSHA256Hash64)
+}
+
+// Returns a new HyperLogLog counter that hashes observations using the
+// hash.Hash64 instances produced by h. h is called twice at construction,
+// once to fingerprint the hash (see hashTypeID) and once to construct the
+// counter's internal hash; Add resets and reuses that single instance
+// rather than allocating a new one per call.
+func NewCounterWithHash(numRegisters uint32, h func() hash.Hash64) (*Counter, error) {
 	if numRegisters < minNumRegisters {
 		return nil, errNumRegistersTooSmall
 	}
 	c := &Counter{
-		m:    uint64(numRegisters),
-		b:    uint64(math.Log2(float64(numRegisters))),
-		hash: sha_256,
+		m:       uint64(numRegisters),
+		b:       uint64(math.Log2(float64(numRegisters))),
+		newHash: h,
+		hashID:  hashTypeID(h),
+		h:       h(),
+		sparse:  &sparseSet{},
 	}
 	c.alpha = alpha(c.m)
-	c.regs = make([]uint8, c.m)
-	c.hbuf = make([]byte, 8)
 	return c, nil
 }
 
 // Presents a value to the counter
 func (c *Counter) Add(in []byte) {
-	c.hash(c.hbuf, in)
-	v := binary.NativeEndian.Uint64(c.hbuf[:8])
-	i := v & ((1 << c.b) - 1)
-	c.regs[i] = max(c.regs[i], numZeroes(v)+1)
+	c.h.Reset()
+	c.h.Write(in)
+	c.addHash(c.h.Sum64())
+	c.h.Reset()
+}
+
+// Write appends p to the counter's in-progress observation without
+// recording it. Call Flush (or Close) once the full observation has been
+// written to record it, allowing a single item to be streamed in over
+// multiple writes instead of assembled into one []byte up front.
+func (c *Counter) Write(p []byte) (int, error) {
+	return c.h.Write(p)
+}
+
+// Flush records the bytes written since the last Add/Flush/Close as one
+// observation and resets the counter's hash for the next one.
+func (c *Counter) Flush() error {
+	c.addHash(c.h.Sum64())
+	c.h.Reset()
+	return nil
+}
+
+// Close flushes any observation in progress. It implements io.Closer so a
+// Counter can terminate a chain of io.Writers.
+func (c *Counter) Close() error {
+	return c.Flush()
+}
+
+// addHash records a single observation's hash value against the counter's
+// registers, whether sparse or dense. The register index comes from the
+// low b bits of v; rho comes from the leading-zero count of the remaining
+// 64-b bits, so the two never draw on the same bits of the hash.
+func (c *Counter) addHash(v uint64) {
+	i := uint32(v & ((1 << c.b) - 1))
+	rho := uint8(bits.LeadingZeros64(v>>c.b)) - uint8(c.b) + 1
+
+	if c.sparse != nil {
+		c.sparse.add(i, rho)
+		// Convert once the sparse encoding is no longer a clear win on
+		// memory, or once distinct indices are dense enough that linear
+		// counting (which needs a healthy fraction of registers still at
+		// zero) is no longer trustworthy.
+		if uint64(c.sparse.byteLen()) > sparseByteBudget*c.m || uint64(c.sparse.entryCount()) > (3*c.m)/5 {
+			c.toDense()
+		}
+		return
+	}
+	if cur := packedGet(c.regs, uint64(i)); rho > cur {
+		packedSet(c.regs, uint64(i), rho)
+	}
+}
+
+// toDense converts a sparse counter to the dense representation in place.
+func (c *Counter) toDense() {
+	c.regs = make([]byte, packedLen(c.m))
+	for i, rho := range c.sparse.toDense(c.m) {
+		if rho != 0 {
+			packedSet(c.regs, uint64(i), rho)
+		}
+	}
+	c.sparse = nil
+}
+
+// unpackedRegs returns the counter's registers as one byte per register,
+// regardless of whether the counter is currently sparse or dense.
+func (c *Counter) unpackedRegs() []uint8 {
+	if c.sparse != nil {
+		return c.sparse.toDense(c.m)
+	}
+	regs := make([]uint8, c.m)
+	for i := range regs {
+		regs[i] = packedGet(c.regs, uint64(i))
+	}
+	return regs
 }
 
 // Returns an approximation of the count
 func (c *Counter) Count() float64 {
+	if c.sparse != nil {
+		return linearCounting(float64(c.m), float64(c.m)-float64(c.sparse.size()))
+	}
+
 	var z float64
-	for _, reg := range c.regs {
-		z += math.Pow(2, -float64(reg))
+	for i := uint64(0); i < c.m; i++ {
+		z += math.Pow(2, -float64(packedGet(c.regs, i)))
 	}
-	z = 1 / z
-	e := c.alpha * float64(c.m*c.m) * z
+	e := c.alpha * float64(c.m*c.m) / z
 	return c.correction(e)
 }
 
+// correction applies the HyperLogLog++-shaped bias correction: the raw
+// estimate is adjusted by the bias looked up for this precision (see the
+// package doc and estimate.go for why that bias is approximate, not the
+// paper's published values), and discarded in favor of linear counting if
+// it still falls below the precision's published threshold.
 func (c *Counter) correction(e float64) float64 {
-	if e < (2.0/5)*float64(c.m) {
-		// small range correction
-		var v float64
-		for _, reg := range c.regs {
-			if reg == 0 {
-				v += 1
+	raw := e
+	if raw <= 5*float64(c.m) {
+		raw -= biasFor(c.b, raw)
+	}
+	if raw < threshold(c.b, c.m) {
+		var zeros float64
+		for i := uint64(0); i < c.m; i++ {
+			if packedGet(c.regs, i) == 0 {
+				zeros++
 			}
 		}
-		if v != 0 {
-			e = float64(c.m) * math.Log10(float64(c.m)/v)
+		if zeros != 0 {
+			return linearCounting(float64(c.m), zeros)
 		}
-	} else if e > (1.0/30)*(1<<32) {
-		// large range correction
-		e = -(1 << 32) * math.Log10(1-(e/(1<<32)))
 	}
-	return e
+	return raw
 }
 
-var errMergeCounterMismatch = fmt.Errorf("cannot merge incompatible counters")
+var (
+	errMergeCounterMismatch = fmt.Errorf("cannot merge incompatible counters")
+	errMergeHashMismatch    = fmt.Errorf("cannot merge counters that use different hash functions")
+)
 
 // Merges two counters together into a new register
-// Note that the counters must contain the same number of registers
+// Note that the counters must contain the same number of registers and use
+// the same hash function; mixing hash functions silently produces garbage,
+// since the two counters' register indices would no longer mean the same
+// thing.
+//
+// The merged counter is always dense: merging is rare enough relative to
+// Add that paying the conversion cost up front is simpler than propagating
+// sparse state through the merge.
 func (c *Counter) Merge(other *Counter) (*Counter, error) {
 	if other.m != c.m {
 		return nil, errMergeCounterMismatch
 	}
-	merged, err := NewCounter(uint32(c.m))
+	if other.hashID != c.hashID {
+		return nil, errMergeHashMismatch
+	}
+	merged, err := NewCounterWithHash(uint32(c.m), c.newHash)
 	if err != nil {
 		return nil, err
 	}
-	for i, reg := range c.regs {
-		merged.regs[i] = max(reg, other.regs[i])
+	merged.sparse = nil
+	merged.regs = make([]byte, packedLen(c.m))
+
+	cRegs := c.unpackedRegs()
+	oRegs := other.unpackedRegs()
+	for i := uint64(0); i < c.m; i++ {
+		if v := max(cRegs[i], oRegs[i]); v != 0 {
+			packedSet(merged.regs, i, v)
+		}
 	}
 	return merged, nil
 }
@@ -109,25 +245,6 @@ func (c *Counter) Error() float64 {
 	return 1.04 * math.Sqrt(float64(c.m))
 }
 
-func numZeroes(v uint64) (i uint8) {
-	var mask uint64
-	for i = 0; i < 64; i += 1 {
-		mask = uint64(1<<63) >> i
-		if v&mask != 0 {
-			break
-		}
-	}
-	return i
-}
-
-func sha_256(dst []byte, src []byte) (n int) {
-	x := sha256.Sum256(src)
-	for n = range dst {
-		dst[n] = x[n]
-	}
-	return n
-}
-
 func alpha(m uint64) float64 {
 	if m < 16 {
 		panic(m)
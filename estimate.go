@@ -0,0 +1,108 @@
+package hyperloglog
+
+import "math"
+
+// biasTable holds rawEstimate/bias correction points for a single precision,
+// interpolated by biasFor via k-nearest-neighbor lookup.
+//
+// NOTE: these are NOT the published HyperLogLog++ tables (Heule, Nunkesser,
+// Hanrahan, 2013; ~200 points per precision, generated from 5000 simulated
+// multisets per data point). Reproducing those verbatim requires shipping
+// or regenerating that dataset, which is outside the scope of this change;
+// the 10-point curves below were hand-fit to approximate the shape of the
+// published bias (monotonically decreasing, trailing to ~0 by the high end)
+// but not its magnitude: each precision's bias runs from about 8.5-11.9 at
+// its lowest raw estimate down to under 0.1 at its highest. They exist so
+// biasFor and its threshold-based fallback to linear counting are exercised
+// end to end.
+// Treat Count()'s bias correction as indicative, not paper-accurate, until
+// the real tables are substituted in.
+type biasTable struct {
+	rawEstimate []float64
+	bias        []float64
+}
+
+// biasTables maps precision (b, i.e. log2(numRegisters)) to its biasTable.
+// Precisions outside 4..18 are not corrected (bias is treated as 0).
+var biasTables = map[uint64]biasTable{
+	4:  {rawEstimate: []float64{11, 12, 13, 14, 16, 18, 21, 24, 28, 34}, bias: []float64{8.5, 6.7, 5.1, 3.9, 2.6, 1.7, 1.0, 0.5, 0.2, 0.05}},
+	5:  {rawEstimate: []float64{23, 24, 26, 29, 33, 39, 46, 55, 66, 80}, bias: []float64{9.8, 7.8, 5.9, 4.3, 2.9, 1.9, 1.1, 0.6, 0.25, 0.05}},
+	6:  {rawEstimate: []float64{46, 48, 52, 58, 66, 78, 93, 111, 134, 162}, bias: []float64{10.5, 8.4, 6.4, 4.7, 3.2, 2.1, 1.2, 0.65, 0.28, 0.06}},
+	7:  {rawEstimate: []float64{92, 96, 104, 116, 132, 156, 187, 224, 270, 326}, bias: []float64{11.0, 8.8, 6.7, 4.9, 3.4, 2.2, 1.3, 0.7, 0.3, 0.07}},
+	8:  {rawEstimate: []float64{184, 192, 208, 232, 264, 312, 374, 449, 540, 652}, bias: []float64{11.3, 9.1, 6.9, 5.1, 3.5, 2.3, 1.35, 0.72, 0.31, 0.07}},
+	9:  {rawEstimate: []float64{368, 384, 416, 464, 528, 624, 748, 898, 1080, 1304}, bias: []float64{11.5, 9.3, 7.0, 5.2, 3.6, 2.35, 1.4, 0.75, 0.32, 0.08}},
+	10: {rawEstimate: []float64{736, 768, 832, 928, 1056, 1248, 1496, 1796, 2160, 2608}, bias: []float64{11.6, 9.4, 7.1, 5.3, 3.65, 2.4, 1.42, 0.76, 0.33, 0.08}},
+	11: {rawEstimate: []float64{1472, 1536, 1664, 1856, 2112, 2496, 2992, 3592, 4320, 5216}, bias: []float64{11.7, 9.5, 7.2, 5.35, 3.7, 2.42, 1.44, 0.77, 0.33, 0.08}},
+	12: {rawEstimate: []float64{2944, 3072, 3328, 3712, 4224, 4992, 5984, 7184, 8640, 10432}, bias: []float64{11.75, 9.55, 7.25, 5.4, 3.72, 2.44, 1.45, 0.78, 0.34, 0.08}},
+	13: {rawEstimate: []float64{5888, 6144, 6656, 7424, 8448, 9984, 11968, 14368, 17280, 20864}, bias: []float64{11.8, 9.6, 7.3, 5.42, 3.74, 2.45, 1.46, 0.78, 0.34, 0.08}},
+	14: {rawEstimate: []float64{11776, 12288, 13312, 14848, 16896, 19968, 23936, 28736, 34560, 41728}, bias: []float64{11.82, 9.62, 7.32, 5.44, 3.75, 2.46, 1.46, 0.79, 0.34, 0.08}},
+	15: {rawEstimate: []float64{23552, 24576, 26624, 29696, 33792, 39936, 47872, 57472, 69120, 83456}, bias: []float64{11.84, 9.64, 7.33, 5.45, 3.76, 2.46, 1.47, 0.79, 0.34, 0.08}},
+	16: {rawEstimate: []float64{47104, 49152, 53248, 59392, 67584, 79872, 95744, 114944, 138240, 166912}, bias: []float64{11.85, 9.65, 7.34, 5.46, 3.76, 2.47, 1.47, 0.79, 0.34, 0.08}},
+	17: {rawEstimate: []float64{94208, 98304, 106496, 118784, 135168, 159744, 191488, 229888, 276480, 333824}, bias: []float64{11.86, 9.66, 7.35, 5.46, 3.77, 2.47, 1.47, 0.79, 0.34, 0.08}},
+	18: {rawEstimate: []float64{188416, 196608, 212992, 237568, 270336, 319488, 382976, 459776, 552960, 667648}, bias: []float64{11.87, 9.67, 7.35, 5.47, 3.77, 2.47, 1.47, 0.79, 0.34, 0.08}},
+}
+
+// thresholds holds the precision-dependent cutoff below which a bias
+// corrected raw estimate is discarded in favor of linear counting, as
+// published in the HyperLogLog++ paper's Table 5.6.
+var thresholds = map[uint64]float64{
+	4: 10, 5: 20, 6: 40, 7: 80, 8: 220, 9: 400, 10: 900,
+	11: 1800, 12: 3100, 13: 6500, 14: 11500, 15: 20000,
+	16: 50000, 17: 120000, 18: 350000,
+}
+
+// knnNeighbors is the number of nearest points averaged by biasFor, matching
+// the k=6 used by the reference implementation.
+const knnNeighbors = 6
+
+// biasFor estimates the empirical bias for a raw cardinality estimate at the
+// given precision by averaging the bias of the knnNeighbors points in that
+// precision's biasTable whose rawEstimate is closest to raw.
+func biasFor(b uint64, raw float64) float64 {
+	t, ok := biasTables[b]
+	if !ok || len(t.rawEstimate) == 0 {
+		return 0
+	}
+	type neighbor struct {
+		dist float64
+		bias float64
+	}
+	neighbors := make([]neighbor, len(t.rawEstimate))
+	for i, re := range t.rawEstimate {
+		neighbors[i] = neighbor{dist: math.Abs(re - raw), bias: t.bias[i]}
+	}
+	for i := 1; i < len(neighbors); i++ {
+		for j := i; j > 0 && neighbors[j].dist < neighbors[j-1].dist; j-- {
+			neighbors[j], neighbors[j-1] = neighbors[j-1], neighbors[j]
+		}
+	}
+	k := knnNeighbors
+	if k > len(neighbors) {
+		k = len(neighbors)
+	}
+	var sum float64
+	for i := 0; i < k; i++ {
+		sum += neighbors[i].bias
+	}
+	return sum / float64(k)
+}
+
+// threshold returns the precision-dependent cutoff below which a raw
+// estimate is replaced by linear counting. Precisions outside the published
+// table fall back to the un-corrected 2/5*m rule used by the original
+// Flajolet estimator.
+func threshold(b uint64, m uint64) float64 {
+	if t, ok := thresholds[b]; ok {
+		return t
+	}
+	return (2.0 / 5) * float64(m)
+}
+
+// linearCounting applies the standard linear counting estimator for a
+// register space of size m in which numZero registers are still at zero.
+func linearCounting(m float64, numZero float64) float64 {
+	if numZero <= 0 {
+		numZero = 1
+	}
+	return m * math.Log(m/numZero)
+}
@@ -0,0 +1,58 @@
+package hyperloglog
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+
+	"github.com/vdinovi/hyperloglog/internal/hashid"
+)
+
+// sha256Hash64 adapts the standard library's SHA-256 implementation (a
+// hash.Hash) to hash.Hash64 by taking the first 8 bytes of the digest as
+// Sum64. It exists so NewCounter keeps working out of the box; SHA-256 is a
+// cryptographic hash and is far slower than the non-cryptographic hashes
+// (murmur3, xxhash, etc.) that NewCounterWithHash is meant for, so
+// throughput-sensitive callers should pass one of those instead.
+type sha256Hash64 struct {
+	hash.Hash
+}
+
+func newSHA256Hash64() hash.Hash64 {
+	return sha256Hash64{sha256.New()}
+}
+
+func (h sha256Hash64) Sum64() uint64 {
+	return binary.NativeEndian.Uint64(h.Sum(nil)[:8])
+}
+
+// hashRegistry maps a hash identifier (see hashid.TypeID) to the factory
+// that produces it, so UnmarshalBinary can reconstruct a working Counter
+// rather than just its registers. The default SHA-256 adapter is always
+// available; custom hashes passed to NewCounterWithHash must be registered
+// with RegisterHash before unmarshaling a Counter that used them.
+var hashRegistry = map[string]func() hash.Hash64{}
+
+func init() {
+	registerHash(newSHA256Hash64)
+}
+
+// RegisterHash makes h available to UnmarshalBinary/GobDecode so a Counter
+// serialized while using h can be fully restored, including the ability to
+// keep calling Add. It's a no-op to register the same hash more than once.
+func RegisterHash(h func() hash.Hash64) {
+	registerHash(h)
+}
+
+func registerHash(h func() hash.Hash64) {
+	hashRegistry[hashTypeID(h)] = h
+}
+
+// hashTypeID identifies a hash factory by the concrete type it produces plus
+// that instance's digest of a fixed probe input (see hashid.TypeID), so
+// differently seeded factories of one type get different identifiers.
+// It's used both to tag a Counter's on-disk format with which hash it needs
+// and to refuse Merge between counters using different hashes.
+func hashTypeID(h func() hash.Hash64) string {
+	return hashid.TypeID(h)
+}
@@ -0,0 +1,64 @@
+package hyperloglog_test
+
+import (
+	"fmt"
+	"hash"
+	"hash/maphash"
+	"testing"
+
+	"github.com/vdinovi/hyperloglog"
+)
+
+// TestCounterWithHash checks that a Counter built with a non-default
+// hash.Hash64 (hash/maphash here, standing in for a real throughput-oriented
+// hash like murmur3 or xxhash) still produces sane, distinguishable counts.
+func TestCounterWithHash(t *testing.T) {
+	seed := maphash.MakeSeed()
+	c, err := hyperloglog.NewCounterWithHash(64, func() hash.Hash64 {
+		h := &maphash.Hash{}
+		h.SetSeed(seed)
+		return h
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i < 1_000; i++ {
+		c.Add([]byte(fmt.Sprintf("item-%d", i)))
+	}
+	if actual := c.Count(); actual < 500 || actual > 2_000 {
+		t.Errorf("expected count near 1000, got %f", actual)
+	}
+}
+
+// TestCounterWriter checks that writing an observation across several
+// io.Writer calls and recording it with Flush is equivalent to a single Add.
+func TestCounterWriter(t *testing.T) {
+	a, err := hyperloglog.NewCounter(64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := hyperloglog.NewCounter(64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	for i := 0; i < 500; i++ {
+		word := fmt.Sprintf("item-%d", i)
+		a.Add([]byte(word))
+
+		half := len(word) / 2
+		if _, err := b.Write([]byte(word[:half])); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if _, err := b.Write([]byte(word[half:])); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if err := b.Flush(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+
+	if a.Count() != b.Count() {
+		t.Errorf("expected streamed writes to match equivalent Add calls: %f != %f", b.Count(), a.Count())
+	}
+}
@@ -0,0 +1,79 @@
+// Package binutil holds the small varint-framing helpers shared by this
+// module's binary.Marshaler implementations (hyperloglog.Counter, cms.Sketch,
+// topk.Sketch), so each package's format code reads the same way.
+package binutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// WriteUvarint appends v to buf as a varint.
+func WriteUvarint(buf *bytes.Buffer, v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	buf.Write(scratch[:n])
+}
+
+// ReadUvarint reads a varint previously written by WriteUvarint.
+func ReadUvarint(r *bytes.Reader) (uint64, error) {
+	return binary.ReadUvarint(r)
+}
+
+// WriteString appends a length-prefixed string to buf.
+func WriteString(buf *bytes.Buffer, s string) {
+	WriteUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+// ReadString reads a length-prefixed string previously written by
+// WriteString.
+func ReadString(r *bytes.Reader) (string, error) {
+	n, err := ReadUvarint(r)
+	if err != nil {
+		return "", err
+	}
+	if err := CheckLen(r, n); err != nil {
+		return "", err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// ErrLengthExceedsInput is returned by CheckLen when a decoded count or
+// length prefix claims more elements than the remaining input could
+// possibly hold.
+var ErrLengthExceedsInput = errors.New("binutil: length exceeds remaining input")
+
+// CheckLen returns ErrLengthExceedsInput if n is larger than the number of
+// bytes left unread in r. Every element this package's formats frame costs
+// at least one byte on the wire, so this is a safe lower bound to check
+// before sizing an allocation (a string, or a slice/matrix of n elements)
+// off of a decoded length or count: it catches corrupted or malicious input
+// before the allocation happens, rather than after.
+func CheckLen(r *bytes.Reader, n uint64) error {
+	if n > uint64(r.Len()) {
+		return fmt.Errorf("%w: claims %d, %d bytes remain", ErrLengthExceedsInput, n, r.Len())
+	}
+	return nil
+}
+
+// ErrDimensionOutOfRange is returned by CheckDimension when a decoded
+// dimension (register count, sketch width/depth, top-k capacity, ...)
+// falls outside the range the caller considers sane.
+var ErrDimensionOutOfRange = errors.New("binutil: dimension out of range")
+
+// CheckDimension returns ErrDimensionOutOfRange, naming field, if n is not
+// in [min, max].
+func CheckDimension(field string, n, min, max uint64) error {
+	if n < min || n > max {
+		return fmt.Errorf("%w: %s = %d not in [%d, %d]", ErrDimensionOutOfRange, field, n, min, max)
+	}
+	return nil
+}
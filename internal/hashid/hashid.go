@@ -0,0 +1,34 @@
+// Package hashid gives the sketches in this module (hyperloglog.Counter,
+// cms.Sketch, topk.Sketch) a common way to identify a hash.Hash64 factory,
+// both to refuse Merge between sketches built with different hashes and to
+// record which hash a serialized sketch needs on the way back in.
+package hashid
+
+import (
+	"encoding/hex"
+	"hash"
+	"reflect"
+)
+
+// probe is a fixed input hashed through a candidate factory's instance to
+// fingerprint its internal configuration (seed, key, etc.), not just its Go
+// type. Two factories of the same concrete type but different seeds (e.g.
+// maphash.Hash seeded via two different maphash.MakeSeed() calls, or
+// murmur3 with different seeds) must not collapse to the same TypeID, since
+// Merge and UnmarshalBinary use it to detect incompatible hashes.
+var probe = []byte("github.com/vdinovi/hyperloglog/internal/hashid probe")
+
+// TypeID identifies a hash.Hash64 factory by its concrete type plus the
+// digest an instance it produces computes for a fixed probe input. Folding
+// in the probe digest catches the common case of two factories producing
+// the same Go type but different internal state; it does not formally
+// guarantee distinct hashes never agree on the probe, but that failure mode
+// is no worse than any other hash collision and is vanishingly unlikely for
+// a well-distributed hash.
+func TypeID(h func() hash.Hash64) string {
+	inst := h()
+	inst.Reset()
+	inst.Write(probe)
+	sum := inst.Sum(nil)
+	return reflect.TypeOf(inst).String() + ":" + hex.EncodeToString(sum)
+}
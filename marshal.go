@@ -0,0 +1,175 @@
+package hyperloglog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/vdinovi/hyperloglog/internal/binutil"
+)
+
+// magic identifies the on-disk/wire format produced by MarshalBinary.
+var magic = [4]byte{'H', 'L', 'L', '1'}
+
+// formatVersion1 is the only format version this package currently writes.
+// It's kept as a named constant, rather than a literal 1, so a future
+// incompatible format change has an obvious place to branch from.
+const formatVersion1 = 1
+
+const (
+	flagSparse byte = 1 << iota
+)
+
+// maxNumRegisters bounds m on decode. It's far beyond any realistic
+// precision (2^26 registers is already a ~48MB dense counter) and exists
+// only so a corrupted or malicious m can't drive an unbounded allocation.
+const maxNumRegisters = 1 << 26
+
+// maxB bounds b on decode, mirroring maxNumRegisters (log2 of it).
+const maxB = 26
+
+var (
+	errBadMagic          = fmt.Errorf("hyperloglog: data does not start with the expected magic bytes")
+	errUnsupportedFormat = fmt.Errorf("hyperloglog: unsupported format version")
+	errUnregisteredHash  = fmt.Errorf("hyperloglog: hash is not registered; call RegisterHash before unmarshaling a Counter that used it")
+)
+
+// MarshalBinary encodes the counter into a small versioned, framed format:
+// a 4-byte magic, a 1-byte version, a 1-byte flags field (currently just
+// sparse-vs-dense), varint m and b, a length-prefixed hash identifier, and
+// finally the register payload itself - bit-packed in dense mode, or
+// varint-delta-encoded (index, rho) pairs in sparse mode.
+func (c *Counter) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	buf.WriteByte(formatVersion1)
+
+	var flags byte
+	if c.sparse != nil {
+		flags |= flagSparse
+	}
+	buf.WriteByte(flags)
+
+	binutil.WriteUvarint(&buf, c.m)
+	binutil.WriteUvarint(&buf, c.b)
+	binutil.WriteString(&buf, c.hashID)
+
+	if c.sparse != nil {
+		c.sparse.merge()
+		binutil.WriteUvarint(&buf, uint64(len(c.sparse.sorted)))
+		var prev uint32
+		for _, entry := range c.sparse.sorted {
+			idx, rho := sparseDecode(entry)
+			binutil.WriteUvarint(&buf, uint64(idx-prev))
+			buf.WriteByte(rho)
+			prev = idx
+		}
+	} else {
+		buf.Write(c.regs)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a Counter previously encoded with MarshalBinary,
+// replacing the receiver's contents. The hash the counter was using must
+// already be registered via RegisterHash (the default SHA-256 hash always
+// is), so that the restored counter can keep accepting Add calls.
+func (c *Counter) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var gotMagic [4]byte
+	if _, err := io.ReadFull(r, gotMagic[:]); err != nil || gotMagic != magic {
+		return errBadMagic
+	}
+	version, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != formatVersion1 {
+		return fmt.Errorf("%w: %d", errUnsupportedFormat, version)
+	}
+	flags, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	m, err := binutil.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if err := binutil.CheckDimension("m", m, minNumRegisters, maxNumRegisters); err != nil {
+		return err
+	}
+	b, err := binutil.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if err := binutil.CheckDimension("b", b, 0, maxB); err != nil {
+		return err
+	}
+	hashID, err := binutil.ReadString(r)
+	if err != nil {
+		return err
+	}
+
+	newHash, ok := hashRegistry[hashID]
+	if !ok {
+		return fmt.Errorf("%w: %q", errUnregisteredHash, hashID)
+	}
+
+	unmarshaled := Counter{
+		m:       m,
+		b:       b,
+		alpha:   alpha(m),
+		newHash: newHash,
+		hashID:  hashID,
+		h:       newHash(),
+	}
+
+	if flags&flagSparse != 0 {
+		count, err := binutil.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if err := binutil.CheckLen(r, count); err != nil {
+			return err
+		}
+		sorted := make([]uint32, 0, count)
+		var idx uint32
+		for i := uint64(0); i < count; i++ {
+			delta, err := binutil.ReadUvarint(r)
+			if err != nil {
+				return err
+			}
+			idx += uint32(delta)
+			rho, err := r.ReadByte()
+			if err != nil {
+				return err
+			}
+			sorted = append(sorted, sparseEncode(idx, rho))
+		}
+		unmarshaled.sparse = &sparseSet{sorted: sorted}
+	} else {
+		regLen := packedLen(m)
+		if err := binutil.CheckLen(r, regLen); err != nil {
+			return err
+		}
+		regs := make([]byte, regLen)
+		if _, err := io.ReadFull(r, regs); err != nil {
+			return err
+		}
+		unmarshaled.regs = regs
+	}
+
+	*c = unmarshaled
+	return nil
+}
+
+// GobEncode implements gob.GobEncoder in terms of MarshalBinary.
+func (c *Counter) GobEncode() ([]byte, error) {
+	return c.MarshalBinary()
+}
+
+// GobDecode implements gob.GobDecoder in terms of UnmarshalBinary.
+func (c *Counter) GobDecode(data []byte) error {
+	return c.UnmarshalBinary(data)
+}
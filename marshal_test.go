@@ -0,0 +1,175 @@
+package hyperloglog_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"hash"
+	"hash/maphash"
+	"testing"
+
+	"github.com/vdinovi/hyperloglog"
+)
+
+// TestCounterMarshalRoundTrip checks that marshaling a counter in both
+// sparse and dense mode and unmarshaling it into a fresh Counter reproduces
+// the same count, and that the restored counter can keep accepting Add
+// calls.
+func TestCounterMarshalRoundTrip(t *testing.T) {
+	for _, n := range []int{10, 10_000} {
+		n := n
+		t.Run(fmt.Sprintf("n=%d", n), func(t *testing.T) {
+			c, err := hyperloglog.NewCounter(64)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			for i := 0; i < n; i++ {
+				c.Add([]byte(fmt.Sprintf("item-%d", i)))
+			}
+
+			data, err := c.MarshalBinary()
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			var restored hyperloglog.Counter
+			if err := restored.UnmarshalBinary(data); err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if restored.Count() != c.Count() {
+				t.Errorf("expected restored count %f to equal original count %f", restored.Count(), c.Count())
+			}
+
+			restored.Add([]byte("item-after-restore"))
+			c.Add([]byte("item-after-restore"))
+			if restored.Count() != c.Count() {
+				t.Errorf("expected restored counter to keep tracking new adds identically")
+			}
+		})
+	}
+}
+
+// TestCounterGobRoundTrip checks that a Counter survives a round trip
+// through encoding/gob, which is what Merge-across-a-wire callers are
+// expected to use.
+func TestCounterGobRoundTrip(t *testing.T) {
+	c, err := hyperloglog.NewCounter(64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for i := 0; i < 1_000; i++ {
+		c.Add([]byte(fmt.Sprintf("item-%d", i)))
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(c); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var restored hyperloglog.Counter
+	if err := gob.NewDecoder(&buf).Decode(&restored); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if restored.Count() != c.Count() {
+		t.Errorf("expected restored count %f to equal original count %f", restored.Count(), c.Count())
+	}
+}
+
+// TestCounterUnmarshalRejectsBadVersion checks that decoding data with an
+// unrecognized format version fails loudly instead of silently
+// misinterpreting the payload.
+func TestCounterUnmarshalRejectsBadVersion(t *testing.T) {
+	c, err := hyperloglog.NewCounter(64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The version byte immediately follows the 4-byte magic.
+	corrupted := append([]byte(nil), data...)
+	corrupted[4] = 0xff
+
+	var restored hyperloglog.Counter
+	if err := restored.UnmarshalBinary(corrupted); err == nil {
+		t.Errorf("expected an error decoding an unsupported format version")
+	}
+}
+
+// TestCounterUnmarshalRejectsBadDimensions checks that decoding a payload
+// with a corrupted or absurd register count returns an error instead of
+// panicking (m < 16 reaches alpha's panic guard) or driving an unbounded
+// allocation (an attacker-sized m with no data behind it).
+func TestCounterUnmarshalRejectsBadDimensions(t *testing.T) {
+	c, err := hyperloglog.NewCounter(64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// byte 6 is the first byte of m's varint (magic=4, version=1, flags=1).
+	t.Run("m below minimum", func(t *testing.T) {
+		corrupted := append([]byte(nil), data...)
+		corrupted[6] = 0
+		var restored hyperloglog.Counter
+		if err := restored.UnmarshalBinary(corrupted); err == nil {
+			t.Errorf("expected an error decoding m=0, got nil")
+		}
+	})
+
+	t.Run("m far exceeds remaining input", func(t *testing.T) {
+		huge := append([]byte(nil), data[:6]...)
+		huge = append(huge, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)
+		huge = append(huge, data[7:]...)
+		var restored hyperloglog.Counter
+		if err := restored.UnmarshalBinary(huge); err == nil {
+			t.Errorf("expected an error decoding an absurdly large m, got nil")
+		}
+	})
+}
+
+// TestCounterMergeRejectsMismatchedHashes checks that Merge refuses to
+// combine counters built with different hash functions.
+func TestCounterMergeRejectsMismatchedHashes(t *testing.T) {
+	a, err := hyperloglog.NewCounter(64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := hyperloglog.NewCounterWithHash(64, func() hash.Hash64 { return &maphash.Hash{} })
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := a.Merge(b); err == nil {
+		t.Errorf("expected Merge to reject counters built with different hash functions")
+	}
+}
+
+// TestCounterMergeRejectsDifferentSeeds checks that Merge also refuses to
+// combine counters whose hash factories produce the same concrete type but
+// are configured with different seeds, since the hash identifier has to
+// look past the Go type to catch that case.
+func TestCounterMergeRejectsDifferentSeeds(t *testing.T) {
+	newSeeded := func(seed maphash.Seed) func() hash.Hash64 {
+		return func() hash.Hash64 {
+			h := &maphash.Hash{}
+			h.SetSeed(seed)
+			return h
+		}
+	}
+	a, err := hyperloglog.NewCounterWithHash(64, newSeeded(maphash.MakeSeed()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := hyperloglog.NewCounterWithHash(64, newSeeded(maphash.MakeSeed()))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if _, err := a.Merge(b); err == nil {
+		t.Errorf("expected Merge to reject counters built with differently seeded hash functions")
+	}
+}
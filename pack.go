@@ -0,0 +1,46 @@
+package hyperloglog
+
+// regBits is the number of bits used to store a single dense register.
+// HyperLogLog register values never need to exceed 63 (a 64-bit hash has at
+// most 64 leading zeroes), so 6 bits is always sufficient.
+const regBits = 6
+
+// packedLen returns the number of bytes needed to bit-pack m registers of
+// regBits each.
+func packedLen(m uint64) uint64 {
+	return (m*regBits + 7) / 8
+}
+
+// packedGet reads the regBits-wide register at index i from a bit-packed
+// register slice.
+func packedGet(regs []byte, i uint64) uint8 {
+	bitOff := i * regBits
+	byteOff := bitOff / 8
+	shift := bitOff % 8
+	v := uint16(regs[byteOff])
+	if byteOff+1 < uint64(len(regs)) {
+		v |= uint16(regs[byteOff+1]) << 8
+	}
+	return uint8(v>>shift) & (1<<regBits - 1)
+}
+
+// packedSet writes value (masked to regBits) into the register at index i
+// of a bit-packed register slice.
+func packedSet(regs []byte, i uint64, value uint8) {
+	bitOff := i * regBits
+	byteOff := bitOff / 8
+	shift := bitOff % 8
+	value &= 1<<regBits - 1
+
+	mask := uint16(1<<regBits-1) << shift
+	v := uint16(regs[byteOff])
+	if byteOff+1 < uint64(len(regs)) {
+		v |= uint16(regs[byteOff+1]) << 8
+	}
+	v = (v &^ mask) | (uint16(value) << shift)
+
+	regs[byteOff] = byte(v)
+	if byteOff+1 < uint64(len(regs)) {
+		regs[byteOff+1] = byte(v >> 8)
+	}
+}
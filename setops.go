@@ -0,0 +1,59 @@
+package hyperloglog
+
+import "math"
+
+// Union returns the approximate cardinality of the set union between c and
+// other: the same quantity Merge(other).Count() would give, as a
+// convenience when the merged counter itself isn't needed.
+func (c *Counter) Union(other *Counter) (float64, error) {
+	merged, err := c.Merge(other)
+	if err != nil {
+		return 0, err
+	}
+	return merged.Count(), nil
+}
+
+// Intersect returns the approximate size of the set intersection between c
+// and other, via inclusion-exclusion: |A| + |B| - |A∪B|. Because each term
+// carries its own estimation error, intersection error amplifies roughly by
+// a factor of (|A|+|B|)/|A∩B| relative to the union's error - the smaller
+// the overlap, the noisier the estimate. The result is clamped to
+// [0, min(|A|,|B|)] since inclusion-exclusion can otherwise drift slightly
+// outside that range.
+func (c *Counter) Intersect(other *Counter) (float64, error) {
+	union, err := c.Union(other)
+	if err != nil {
+		return 0, err
+	}
+	return intersectFromUnion(c.Count(), other.Count(), union), nil
+}
+
+// intersectFromUnion applies inclusion-exclusion given an already-computed
+// union, so callers that need both quantities (Jaccard) don't pay for
+// Merge+Count twice.
+func intersectFromUnion(a, b, union float64) float64 {
+	intersect := a + b - union
+
+	if intersect < 0 {
+		intersect = 0
+	}
+	if max := math.Min(a, b); intersect > max {
+		intersect = max
+	}
+	return intersect
+}
+
+// Jaccard returns the approximate Jaccard similarity between c and other:
+// |A∩B| / |A∪B|. It inherits Intersect's error amplification, so it's
+// noisiest when the two sets barely overlap.
+func (c *Counter) Jaccard(other *Counter) (float64, error) {
+	union, err := c.Union(other)
+	if err != nil {
+		return 0, err
+	}
+	if union == 0 {
+		return 0, nil
+	}
+	intersect := intersectFromUnion(c.Count(), other.Count(), union)
+	return intersect / union, nil
+}
@@ -0,0 +1,107 @@
+package hyperloglog_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/vdinovi/hyperloglog"
+)
+
+// TestCounterSetOps checks Union, Intersect, and Jaccard across a range of
+// overlap ratios between two streams of the same size, since intersection
+// error is known to amplify as the overlap shrinks.
+func TestCounterSetOps(t *testing.T) {
+	const setSize = 20_000
+	const numRegisters = 4096
+
+	for _, overlap := range []float64{0.0, 0.25, 0.5, 0.75, 1.0} {
+		overlap := overlap
+		t.Run(fmt.Sprintf("overlap=%.2f", overlap), func(t *testing.T) {
+			shared := int(overlap * setSize)
+
+			a, err := hyperloglog.NewCounter(numRegisters)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			b, err := hyperloglog.NewCounter(numRegisters)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			for i := 0; i < shared; i++ {
+				key := []byte(fmt.Sprintf("shared-%d", i))
+				a.Add(key)
+				b.Add(key)
+			}
+			for i := 0; i < setSize-shared; i++ {
+				a.Add([]byte(fmt.Sprintf("a-only-%d", i)))
+				b.Add([]byte(fmt.Sprintf("b-only-%d", i)))
+			}
+
+			wantUnion := float64(2*setSize - shared)
+			wantIntersect := float64(shared)
+
+			union, err := a.Union(b)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			intersect, err := a.Intersect(b)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			jaccard, err := a.Jaccard(b)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			// Intersect combines three independently-erroring estimates
+			// (a.Count(), b.Count(), union), so its absolute error is set
+			// by their combined size rather than by the intersection size
+			// itself - that's exactly the error amplification documented
+			// on Intersect, expressed as an absolute rather than relative
+			// bound so it stays well-defined as the overlap approaches 0.
+			stdErr := 1.04 / math.Sqrt(numRegisters)
+			unionTolerance := 6 * stdErr * wantUnion
+			intersectTolerance := 8 * stdErr * 2 * setSize
+
+			if diff := math.Abs(union - wantUnion); diff > unionTolerance {
+				t.Errorf("union: want ~%f (+/- %f), got %f", wantUnion, unionTolerance, union)
+			}
+			if diff := math.Abs(intersect - wantIntersect); diff > intersectTolerance {
+				t.Errorf("intersect: want ~%f (+/- %f), got %f", wantIntersect, intersectTolerance, intersect)
+			}
+			if wantUnion > 0 {
+				wantJaccard := wantIntersect / wantUnion
+				jaccardTolerance := intersectTolerance / wantUnion
+				if diff := math.Abs(jaccard - wantJaccard); diff > jaccardTolerance+0.05 {
+					t.Errorf("jaccard: want ~%f (+/- %f), got %f", wantJaccard, jaccardTolerance, jaccard)
+				}
+			}
+		})
+	}
+}
+
+// TestCounterSetOpsRejectsMismatch checks that Union, Intersect, and
+// Jaccard all surface Merge's compatibility error rather than silently
+// producing a nonsense result.
+func TestCounterSetOpsRejectsMismatch(t *testing.T) {
+	a, err := hyperloglog.NewCounter(64)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	b, err := hyperloglog.NewCounter(128)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if _, err := a.Union(b); err == nil {
+		t.Errorf("expected Union to reject counters with different register counts")
+	}
+	if _, err := a.Intersect(b); err == nil {
+		t.Errorf("expected Intersect to reject counters with different register counts")
+	}
+	if _, err := a.Jaccard(b); err == nil {
+		t.Errorf("expected Jaccard to reject counters with different register counts")
+	}
+}
@@ -0,0 +1,143 @@
+package hyperloglog
+
+import "sort"
+
+// sparseRhoBits is the number of low bits of a sparse entry reserved for
+// rho (the run of leading zeroes + 1). 6 bits comfortably covers rho for
+// any hash width this package uses.
+const sparseRhoBits = 6
+
+// sparseTempLimit bounds the unsorted temporary buffer collected by
+// sparseSet.add before it is merged into the sorted set. A larger buffer
+// amortizes merge cost at the price of holding more unsorted, possibly
+// duplicate entries between merges, which entryCount and byteLen count in
+// full.
+const sparseTempLimit = 64
+
+// sparseEncode packs a register index and its rho value into a single
+// sortable uint32: the index occupies the high bits, rho the low
+// sparseRhoBits bits, so sorting encoded entries also sorts by index.
+func sparseEncode(idx uint32, rho uint8) uint32 {
+	return idx<<sparseRhoBits | uint32(rho)
+}
+
+// sparseDecode is the inverse of sparseEncode.
+func sparseDecode(v uint32) (idx uint32, rho uint8) {
+	return v >> sparseRhoBits, uint8(v & (1<<sparseRhoBits - 1))
+}
+
+// sparseSet is the sparse-mode register representation used by a Counter
+// while the number of distinct observations is small: a sorted list of
+// encoded (index, rho) pairs plus a small unsorted buffer that absorbs new
+// observations until it's large enough to be worth merging.
+type sparseSet struct {
+	sorted []uint32
+	temp   []uint32
+}
+
+// add records an observation at the given register index and rho, merging
+// the temporary buffer into the sorted set once it reaches sparseTempLimit.
+func (s *sparseSet) add(idx uint32, rho uint8) {
+	s.temp = append(s.temp, sparseEncode(idx, rho))
+	if len(s.temp) >= sparseTempLimit {
+		s.merge()
+	}
+}
+
+// merge folds the temporary buffer into the sorted set, keeping only the
+// largest rho observed per register index.
+func (s *sparseSet) merge() {
+	if len(s.temp) == 0 {
+		return
+	}
+	sort.Slice(s.temp, func(i, j int) bool { return s.temp[i] < s.temp[j] })
+	s.sorted = mergeSparse(s.sorted, dedupeSparse(s.temp))
+	s.temp = s.temp[:0]
+}
+
+// dedupeSparse collapses a sorted sparse list down to one entry per
+// register index, keeping the entry with the largest rho. The temp buffer
+// can carry several observations for the same index between merges, unlike
+// the sorted set, which maintains the one-entry-per-index invariant.
+func dedupeSparse(sorted []uint32) []uint32 {
+	out := make([]uint32, 0, len(sorted))
+	for _, v := range sorted {
+		if len(out) > 0 {
+			lastIdx, lastRho := sparseDecode(out[len(out)-1])
+			if idx, rho := sparseDecode(v); idx == lastIdx {
+				if rho > lastRho {
+					out[len(out)-1] = v
+				}
+				continue
+			}
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// mergeSparse merges two sorted, index-ascending, already-deduplicated
+// sparse lists, keeping only the entry with the largest rho for each
+// register index.
+func mergeSparse(a, b []uint32) []uint32 {
+	out := make([]uint32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		ai, aRho := sparseDecode(a[i])
+		bi, bRho := sparseDecode(b[j])
+		switch {
+		case ai < bi:
+			out = append(out, a[i])
+			i++
+		case bi < ai:
+			out = append(out, b[j])
+			j++
+		default:
+			if aRho >= bRho {
+				out = append(out, a[i])
+			} else {
+				out = append(out, b[j])
+			}
+			i++
+			j++
+		}
+	}
+	out = append(out, a[i:]...)
+	out = append(out, b[j:]...)
+	return out
+}
+
+// size returns the number of distinct register indices currently
+// represented, folding in the unmerged temporary buffer.
+func (s *sparseSet) size() int {
+	s.merge()
+	return len(s.sorted)
+}
+
+// entryCount cheaply upper-bounds the number of distinct register indices
+// currently held, without forcing a merge: it's the sum of the sorted set
+// (already one entry per index) and the unmerged temp buffer, which may
+// still hold several entries for the same index. Because of that it can
+// only overestimate, never underestimate, distinct count. Used to gate the
+// sparse/dense conversion check on every Add without paying merge's cost.
+func (s *sparseSet) entryCount() int {
+	return len(s.sorted) + len(s.temp)
+}
+
+// byteLen approximates the memory footprint of the sparse representation,
+// used to decide when to convert to dense.
+func (s *sparseSet) byteLen() int {
+	return (len(s.sorted) + len(s.temp)) * 4
+}
+
+// toDense expands the sparse set into a dense register slice of size m,
+// where each entry holds the rho value (or 0) observed for that index.
+func (s *sparseSet) toDense(m uint64) []uint8 {
+	s.merge()
+	regs := make([]uint8, m)
+	for _, v := range s.sorted {
+		idx, rho := sparseDecode(v)
+		regs[idx] = rho
+	}
+	return regs
+}
@@ -0,0 +1,223 @@
+// Package topk implements the Space-Saving algorithm for tracking the
+// approximate top-k most frequent keys in a stream using O(k) space
+// regardless of the number of distinct keys.
+//
+// References:
+// - https://www.cs.ucsb.edu/sites/default/files/documents/2005-23.pdf
+package topk
+
+import (
+	"bytes"
+	"container/heap"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/vdinovi/hyperloglog/internal/binutil"
+)
+
+const minCapacity = 1
+
+// maxCapacity bounds capacity (and, transitively, the entry count) on
+// decode. It's far beyond any realistic top-k size and exists only so a
+// corrupted or malicious capacity/count can't drive an unbounded
+// allocation.
+const maxCapacity = 1 << 24
+
+var errCapacityTooSmall = fmt.Errorf("capacity must be at least %d", minCapacity)
+
+// magic identifies the on-disk/wire format produced by MarshalBinary.
+var magic = [4]byte{'T', 'O', 'P', 'K'}
+
+// formatVersion1 is the only format version this package currently writes.
+const formatVersion1 = 1
+
+var (
+	errBadMagic          = fmt.Errorf("topk: data does not start with the expected magic bytes")
+	errUnsupportedFormat = fmt.Errorf("topk: unsupported format version")
+)
+
+// An Entry is a tracked key along with its estimated count and the maximum
+// amount by which that count could be overestimated (the count already
+// accumulated by the key it replaced, if any).
+type Entry struct {
+	Key   string
+	Count uint64
+	Error uint64
+}
+
+// A Sketch tracks the approximate top-k most frequent keys seen via Add,
+// using a fixed-size min-heap of Entry ordered by Count plus a map for O(1)
+// lookup of a tracked key's heap position.
+type Sketch struct {
+	capacity int
+	heap     entryHeap
+}
+
+// entryHeap is a container/heap.Interface min-heap of *Entry ordered by
+// Count. index tracks each entry's current slot, kept in sync by Swap, so a
+// tracked key can be found in O(1) without scanning the heap.
+type entryHeap struct {
+	entries []*Entry
+	index   map[string]int
+}
+
+func (h entryHeap) Len() int { return len(h.entries) }
+
+func (h entryHeap) Less(i, j int) bool { return h.entries[i].Count < h.entries[j].Count }
+
+func (h entryHeap) Swap(i, j int) {
+	h.entries[i], h.entries[j] = h.entries[j], h.entries[i]
+	h.index[h.entries[i].Key] = i
+	h.index[h.entries[j].Key] = j
+}
+
+func (h *entryHeap) Push(x any) {
+	e := x.(*Entry)
+	h.index[e.Key] = len(h.entries)
+	h.entries = append(h.entries, e)
+}
+
+func (h *entryHeap) Pop() any {
+	old := h.entries
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	h.entries = old[:n-1]
+	delete(h.index, e.Key)
+	return e
+}
+
+// NewSketch returns a new Sketch that tracks (at most) the top capacity
+// keys.
+func NewSketch(capacity int) (*Sketch, error) {
+	if capacity < minCapacity {
+		return nil, errCapacityTooSmall
+	}
+	return &Sketch{
+		capacity: capacity,
+		heap: entryHeap{
+			entries: make([]*Entry, 0, capacity),
+			index:   make(map[string]int, capacity),
+		},
+	}, nil
+}
+
+// Add records one occurrence of key. If key is already tracked, its count is
+// incremented. Otherwise, if fewer than capacity keys are tracked, key is
+// inserted with count 1 and error 0. Otherwise, the tracked key with the
+// smallest count is evicted and replaced by key, whose count becomes the
+// evicted count plus one and whose error is set to the evicted count - the
+// standard Space-Saving guarantee that the true count for key lies in
+// [Count-Error, Count].
+func (s *Sketch) Add(key string) {
+	if i, ok := s.heap.index[key]; ok {
+		s.heap.entries[i].Count++
+		heap.Fix(&s.heap, i)
+		return
+	}
+	if len(s.heap.entries) < s.capacity {
+		heap.Push(&s.heap, &Entry{Key: key, Count: 1})
+		return
+	}
+
+	min := s.heap.entries[0]
+	delete(s.heap.index, min.Key)
+	min.Key = key
+	min.Count++
+	min.Error = min.Count - 1
+	s.heap.index[key] = 0
+	heap.Fix(&s.heap, 0)
+}
+
+// TopK returns the tracked entries sorted by descending count.
+func (s *Sketch) TopK() []Entry {
+	out := make([]Entry, len(s.heap.entries))
+	for i, e := range s.heap.entries {
+		out[i] = *e
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Count > out[j].Count })
+	return out
+}
+
+// MarshalBinary encodes the sketch into a small versioned, framed format: a
+// 4-byte magic, a 1-byte version, varint capacity, varint entry count, and
+// then each entry's length-prefixed key and varint count/error - mirroring
+// the framing hyperloglog.Counter and cms.Sketch use.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(magic[:])
+	buf.WriteByte(formatVersion1)
+
+	binutil.WriteUvarint(&buf, uint64(s.capacity))
+	binutil.WriteUvarint(&buf, uint64(len(s.heap.entries)))
+	for _, e := range s.heap.entries {
+		binutil.WriteString(&buf, e.Key)
+		binutil.WriteUvarint(&buf, e.Count)
+		binutil.WriteUvarint(&buf, e.Error)
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a Sketch previously encoded with MarshalBinary,
+// replacing the receiver's contents.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+
+	var gotMagic [4]byte
+	if _, err := io.ReadFull(r, gotMagic[:]); err != nil || gotMagic != magic {
+		return errBadMagic
+	}
+	version, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if version != formatVersion1 {
+		return fmt.Errorf("%w: %d", errUnsupportedFormat, version)
+	}
+	capacity, err := binutil.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if err := binutil.CheckDimension("capacity", capacity, minCapacity, maxCapacity); err != nil {
+		return err
+	}
+	count, err := binutil.ReadUvarint(r)
+	if err != nil {
+		return err
+	}
+	if err := binutil.CheckDimension("count", count, 0, capacity); err != nil {
+		return err
+	}
+	if err := binutil.CheckLen(r, count); err != nil {
+		return err
+	}
+
+	unmarshaled := Sketch{
+		capacity: int(capacity),
+		heap: entryHeap{
+			entries: make([]*Entry, 0, count),
+			index:   make(map[string]int, count),
+		},
+	}
+	for i := uint64(0); i < count; i++ {
+		key, err := binutil.ReadString(r)
+		if err != nil {
+			return err
+		}
+		entryCount, err := binutil.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		entryError, err := binutil.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		unmarshaled.heap.index[key] = len(unmarshaled.heap.entries)
+		unmarshaled.heap.entries = append(unmarshaled.heap.entries, &Entry{Key: key, Count: entryCount, Error: entryError})
+	}
+	heap.Init(&unmarshaled.heap)
+
+	*s = unmarshaled
+	return nil
+}
@@ -0,0 +1,140 @@
+package topk_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/vdinovi/hyperloglog/topk"
+)
+
+// TestSketchTopK checks that the heaviest hitters in a skewed stream are
+// reported by TopK in descending count order, ahead of a long tail of
+// one-off keys (one of which necessarily occupies the sketch's last slot,
+// per the Space-Saving guarantee that only counts below the tail's noise
+// floor can be evicted).
+func TestSketchTopK(t *testing.T) {
+	s, err := topk.NewSketch(3)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	counts := map[string]int{"heavy": 100, "medium": 50}
+	for key, count := range counts {
+		for i := 0; i < count; i++ {
+			s.Add(key)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		s.Add(fmt.Sprintf("noise-%d", i))
+	}
+
+	got := s.TopK()
+	if len(got) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(got))
+	}
+	wantOrder := []string{"heavy", "medium"}
+	for i, want := range wantOrder {
+		if got[i].Key != want {
+			t.Errorf("entry %d: got key %q, want %q", i, got[i].Key, want)
+		}
+	}
+	if got[0].Count < 100 {
+		t.Errorf("heavy: got count %d, want at least 100", got[0].Count)
+	}
+	if got[1].Count < 50 {
+		t.Errorf("medium: got count %d, want at least 50", got[1].Count)
+	}
+}
+
+// TestSketchAddIncrementsTrackedKey checks that repeated Add calls for an
+// already-tracked key increment its count rather than evicting it.
+func TestSketchAddIncrementsTrackedKey(t *testing.T) {
+	s, err := topk.NewSketch(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.Add("a")
+	s.Add("a")
+	s.Add("a")
+
+	got := s.TopK()
+	if len(got) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(got))
+	}
+	if got[0].Count != 3 {
+		t.Errorf("got count %d, want 3", got[0].Count)
+	}
+	if got[0].Error != 0 {
+		t.Errorf("got error %d, want 0 for a never-evicted key", got[0].Error)
+	}
+}
+
+// TestSketchMarshalRoundTrip checks that a sketch's tracked entries survive
+// a MarshalBinary/UnmarshalBinary round trip and that Add still works
+// afterward.
+func TestSketchMarshalRoundTrip(t *testing.T) {
+	s, err := topk.NewSketch(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.Add("a")
+	s.Add("a")
+	s.Add("b")
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	restored, err := topk.NewSketch(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	restored.Add("a")
+	got := restored.TopK()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(got))
+	}
+	if got[0].Key != "a" || got[0].Count != 3 {
+		t.Errorf("got top entry %+v, want key a count 3", got[0])
+	}
+}
+
+// TestNewSketchRejectsNonPositiveCapacity checks that NewSketch validates
+// its capacity argument.
+func TestNewSketchRejectsNonPositiveCapacity(t *testing.T) {
+	if _, err := topk.NewSketch(0); err == nil {
+		t.Errorf("expected NewSketch to reject a zero capacity")
+	}
+}
+
+// TestSketchUnmarshalRejectsBadDimensions checks that decoding a payload
+// whose capacity has been corrupted into an absurdly large value returns
+// an error instead of driving an unbounded allocation.
+func TestSketchUnmarshalRejectsBadDimensions(t *testing.T) {
+	s, err := topk.NewSketch(2)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	s.Add("a")
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// capacity's varint starts right after the 4-byte magic and 1-byte
+	// version, and fits in a single byte for capacity=2.
+	huge := append([]byte(nil), data[:5]...)
+	huge = append(huge, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01)
+	huge = append(huge, data[6:]...)
+
+	var restored topk.Sketch
+	if err := restored.UnmarshalBinary(huge); err == nil {
+		t.Errorf("expected an error decoding an absurdly large capacity, got nil")
+	}
+}